@@ -4,27 +4,78 @@ package traefik_plugin_proxy_cookie //nolint
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
+	"os"
+	"path"
 	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
 )
 
 const setCookieHeader string = "Set-Cookie"
+const cookieHeader string = "Cookie"
+const requestIDHeader string = "X-Request-Id"
 
 // Rewrite definition of a replacement.
 type Rewrite struct {
 	Regex       string `json:"regex,omitempty" toml:"regex,omitempty" yaml:"regex,omitempty"`
 	Replacement string `json:"replacement,omitempty" toml:"replacement,omitempty" yaml:"replacement,omitempty"`
+	When        When   `json:"when,omitempty" toml:"when,omitempty" yaml:"when,omitempty"`
+}
+
+// When restricts a Rewrite to requests/responses matching all of the
+// non-empty conditions. An empty When always matches.
+type When struct {
+	HostRegex string `json:"hostRegex,omitempty" toml:"hostRegex,omitempty" yaml:"hostRegex,omitempty"`
+	PathRegex string `json:"pathRegex,omitempty" toml:"pathRegex,omitempty" yaml:"pathRegex,omitempty"`
+	Status    []int  `json:"status,omitempty" toml:"status,omitempty" yaml:"status,omitempty"`
 }
 
 type rewrite struct {
 	regex       *regexp.Regexp
 	replacement string
+	hostRegex   *regexp.Regexp
+	pathRegex   *regexp.Regexp
+	status      []int
+}
+
+// matches reports whether the rule's conditions allow it to apply to the
+// given request and outgoing status code.
+func (rw rewrite) matches(req *http.Request, statusCode int) bool {
+	if rw.hostRegex != nil && !rw.hostRegex.MatchString(req.Host) {
+		return false
+	}
+
+	if rw.pathRegex != nil && !rw.pathRegex.MatchString(req.URL.Path) {
+		return false
+	}
+
+	if len(rw.status) > 0 && !containsInt(rw.status, statusCode) {
+		return false
+	}
+
+	return true
+}
+
+func containsInt(values []int, target int) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
 }
 
 type domainConfig struct {
-	Rewrites []Rewrite `json:"rewrites,omitempty" toml:"rewrites,omitempty" yaml:"rewrites,omitempty"`
+	Rewrites            []Rewrite `json:"rewrites,omitempty" toml:"rewrites,omitempty" yaml:"rewrites,omitempty"`
+	EnforcePublicSuffix bool      `json:"enforcePublicSuffix,omitempty" toml:"enforcePublicSuffix,omitempty" yaml:"enforcePublicSuffix,omitempty"`
+	OnInvalid           string    `json:"onInvalid,omitempty" toml:"onInvalid,omitempty" yaml:"onInvalid,omitempty"`
 }
 
 type pathConfig struct {
@@ -32,10 +83,52 @@ type pathConfig struct {
 	Rewrites []Rewrite `json:"rewrites,omitempty" toml:"rewrites,omitempty" yaml:"rewrites,omitempty"`
 }
 
+// CookieFilter lists cookie names to allow or deny from the upstream
+// Set-Cookie stream before any rewrites run. Names support exact matches
+// plus glob patterns (e.g. "_ga_*").
+type CookieFilter struct {
+	DenyAll bool     `json:"denyAll,omitempty" toml:"denyAll,omitempty" yaml:"denyAll,omitempty"`
+	Allow   []string `json:"allow,omitempty" toml:"allow,omitempty" yaml:"allow,omitempty"`
+	Deny    []string `json:"deny,omitempty" toml:"deny,omitempty" yaml:"deny,omitempty"`
+}
+
+// RequestCookieConfig controls rewriting of the inbound `Cookie` request
+// header, the symmetric counterpart to the `Set-Cookie` rewrites above.
+//
+// There is no PathPrefixStrip here: PathConfig.Prefix is only ever applied
+// to cookie.Path, and the Cookie request header never echoes Path back, so
+// there is nothing on the request side to strip a path prefix out of yet.
+type RequestCookieConfig struct {
+	Rewrites []Rewrite `json:"rewrites,omitempty" toml:"rewrites,omitempty" yaml:"rewrites,omitempty"`
+	Strip    []string  `json:"strip,omitempty" toml:"strip,omitempty" yaml:"strip,omitempty"`
+}
+
+// AttributeConfig unconditionally sets or clears cookie attributes on every
+// outbound Set-Cookie after the path/domain rewrites run. Leave a field nil
+// to pass the upstream value through untouched.
+//
+// Partitioned (CHIPS) is delivered by appending "; Partitioned" to the
+// already-serialized Set-Cookie value (see appendPartitionedAttribute)
+// rather than through http.Cookie.Partitioned, since that field only exists
+// from Go 1.23 and this module floors at go1.21. Partitioned can only add
+// the attribute: false has the same effect as leaving it nil.
+type AttributeConfig struct {
+	Secure                      *bool  `json:"secure,omitempty" toml:"secure,omitempty" yaml:"secure,omitempty"`
+	HTTPOnly                    *bool  `json:"httpOnly,omitempty" toml:"httpOnly,omitempty" yaml:"httpOnly,omitempty"`
+	SameSite                    string `json:"sameSite,omitempty" toml:"sameSite,omitempty" yaml:"sameSite,omitempty"`
+	MaxAge                      *int   `json:"maxAge,omitempty" toml:"maxAge,omitempty" yaml:"maxAge,omitempty"`
+	Partitioned                 *bool  `json:"partitioned,omitempty" toml:"partitioned,omitempty" yaml:"partitioned,omitempty"`
+	ForceSecureWhenSameSiteNone bool   `json:"forceSecureWhenSameSiteNone,omitempty" toml:"forceSecureWhenSameSiteNone,omitempty" yaml:"forceSecureWhenSameSiteNone,omitempty"`
+}
+
 // Config holding the prefix to add.
 type Config struct {
-	PathConfig   pathConfig   `json:"path,omitempty" toml:"path,omitempty" yaml:"path,omitempty"`
-	DomainConfig domainConfig `json:"domain,omitempty" toml:"domain,omitempty" yaml:"domain,omitempty"`
+	PathConfig          pathConfig          `json:"path,omitempty" toml:"path,omitempty" yaml:"path,omitempty"`
+	DomainConfig        domainConfig        `json:"domain,omitempty" toml:"domain,omitempty" yaml:"domain,omitempty"`
+	CookieFilter        CookieFilter        `json:"cookieFilter,omitempty" toml:"cookieFilter,omitempty" yaml:"cookieFilter,omitempty"`
+	RequestCookieConfig RequestCookieConfig `json:"requestCookie,omitempty" toml:"requestCookie,omitempty" yaml:"requestCookie,omitempty"`
+	AttributeConfig     AttributeConfig     `json:"attributes,omitempty" toml:"attributes,omitempty" yaml:"attributes,omitempty"`
+	LogLevel            string              `json:"logLevel,omitempty" toml:"logLevel,omitempty" yaml:"logLevel,omitempty"`
 }
 
 // CreateConfig creates and initializes the plugin configuration.
@@ -43,13 +136,138 @@ func CreateConfig() *Config {
 	return &Config{}
 }
 
+type logLevel int
+
+const (
+	logLevelSilent logLevel = iota
+	logLevelInfo
+	logLevelDebug
+)
+
+func parseLogLevel(value string) logLevel {
+	switch value {
+	case "debug":
+		return logLevelDebug
+	case "info":
+		return logLevelInfo
+	default:
+		return logLevelSilent
+	}
+}
+
+// logger is the minimal leveled logging surface the plugin writes its
+// (redacted) audit trail through.
+type logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+}
+
+// jsonLogger is the Traefik-compatible default: one JSON line per entry on
+// stderr, tagged with the plugin name and the inbound X-Request-Id so log
+// lines can be correlated with a request. Never given a raw cookie value.
+type jsonLogger struct {
+	out       *os.File
+	plugin    string
+	requestID string
+	level     logLevel
+}
+
+type logEntry struct {
+	Time      string `json:"time"`
+	Level     string `json:"level"`
+	Plugin    string `json:"name"`
+	RequestID string `json:"requestId,omitempty"`
+	Message   string `json:"message"`
+}
+
+func (l *jsonLogger) emit(level logLevel, levelName, format string, args ...interface{}) {
+	if level > l.level {
+		return
+	}
+
+	entry := logEntry{
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		Level:     levelName,
+		Plugin:    l.plugin,
+		RequestID: l.requestID,
+		Message:   fmt.Sprintf(format, args...),
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintln(l.out, string(data))
+}
+
+func (l *jsonLogger) Debugf(format string, args ...interface{}) {
+	l.emit(logLevelDebug, "debug", format, args...)
+}
+
+func (l *jsonLogger) Infof(format string, args ...interface{}) {
+	l.emit(logLevelInfo, "info", format, args...)
+}
+
+func (l *jsonLogger) Warnf(format string, args ...interface{}) {
+	l.emit(logLevelInfo, "warn", format, args...)
+}
+
+// maskValue never lets a cookie value reach a log line; it reports only the
+// byte length, enough to spot truncation bugs without leaking the secret.
+func maskValue(value string) string {
+	return fmt.Sprintf("<%d bytes>", len(value))
+}
+
+// Stats is a point-in-time snapshot of plugin activity counters,
+// retrievable via ProxieCookiePlugin.StatsHandler. RewritesApplied counts
+// every cookie that left the plugin changed in any way — Set-Cookie
+// path/domain/attribute rewrites and request-side Cookie rewrites alike.
+type Stats struct {
+	RewritesApplied        uint64 `json:"rewritesApplied"`
+	CookiesDroppedByFilter uint64 `json:"cookiesDroppedByFilter"`
+	InvalidDomainsRejected uint64 `json:"invalidDomainsRejected"`
+}
+
+type statsCounters struct {
+	rewritesApplied        uint64
+	cookiesDroppedByFilter uint64
+	invalidDomainsRejected uint64
+}
+
+func (s *statsCounters) snapshot() Stats {
+	return Stats{
+		RewritesApplied:        atomic.LoadUint64(&s.rewritesApplied),
+		CookiesDroppedByFilter: atomic.LoadUint64(&s.cookiesDroppedByFilter),
+		InvalidDomainsRejected: atomic.LoadUint64(&s.invalidDomainsRejected),
+	}
+}
+
 // ProxieCookiePlugin a traefik plugin providing the functionality of the nginx proxy_cookie directives tp traefik.
 type ProxieCookiePlugin struct {
-	next           http.Handler
-	name           string
-	domainRewrites []rewrite
-	pathPrefix     string
-	pathRewrites   []rewrite
+	next                  http.Handler
+	name                  string
+	domainRewrites        []rewrite
+	pathPrefix            string
+	pathRewrites          []rewrite
+	cookieFilter          CookieFilter
+	requestCookieRewrites []rewrite
+	requestCookieStrip    []string
+	attributeConfig       AttributeConfig
+	enforcePublicSuffix   bool
+	onInvalidDomain       string
+	logLevel              logLevel
+	stats                 *statsCounters
+}
+
+// StatsHandler returns an http.Handler serving the plugin's current Stats as
+// JSON; mount it on a debug route to monitor the plugin in production.
+func (p *ProxieCookiePlugin) StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(p.stats.snapshot())
+	})
 }
 
 // New creates a Path Prefixer.
@@ -64,12 +282,33 @@ func New(_ context.Context, next http.Handler, config *Config, name string) (htt
 		return nil, err
 	}
 
+	requestCookieRewrites, err := convertRewrites(config.RequestCookieConfig.Rewrites)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateSameSite(config.AttributeConfig.SameSite); err != nil {
+		return nil, err
+	}
+
+	if err := validateOnInvalid(config.DomainConfig.OnInvalid); err != nil {
+		return nil, err
+	}
+
 	return &ProxieCookiePlugin{
-		name:           name,
-		next:           next,
-		domainRewrites: domainRewrites,
-		pathPrefix:     config.PathConfig.Prefix,
-		pathRewrites:   pathRewrites,
+		name:                  name,
+		next:                  next,
+		domainRewrites:        domainRewrites,
+		pathPrefix:            config.PathConfig.Prefix,
+		pathRewrites:          pathRewrites,
+		cookieFilter:          config.CookieFilter,
+		requestCookieRewrites: requestCookieRewrites,
+		requestCookieStrip:    config.RequestCookieConfig.Strip,
+		attributeConfig:       config.AttributeConfig,
+		enforcePublicSuffix:   config.DomainConfig.EnforcePublicSuffix,
+		onInvalidDomain:       config.DomainConfig.OnInvalid,
+		logLevel:              parseLogLevel(config.LogLevel),
+		stats:                 &statsCounters{},
 	}, nil
 }
 
@@ -77,34 +316,136 @@ func convertRewrites(rewriteConfigs []Rewrite) ([]rewrite, error) {
 	rewrites := make([]rewrite, len(rewriteConfigs))
 
 	for i, rewriteConfig := range rewriteConfigs {
+		var hostRegex, pathRegex *regexp.Regexp
+
+		if rewriteConfig.When.HostRegex != "" {
+			compiled, err := regexp.Compile(rewriteConfig.When.HostRegex)
+			if err != nil {
+				return nil, fmt.Errorf("error compiling when.hostRegex %q: %w", rewriteConfig.When.HostRegex, err)
+			}
+			hostRegex = compiled
+		}
+
+		if rewriteConfig.When.PathRegex != "" {
+			compiled, err := regexp.Compile(rewriteConfig.When.PathRegex)
+			if err != nil {
+				return nil, fmt.Errorf("error compiling when.pathRegex %q: %w", rewriteConfig.When.PathRegex, err)
+			}
+			pathRegex = compiled
+		}
+
 		regexp, err := regexp.Compile(rewriteConfig.Regex)
 		if err != nil {
 			return nil, fmt.Errorf("error compiling regex %q: %w", rewriteConfig.Regex, err)
 		}
+
 		rewrites[i] = rewrite{
 			regex:       regexp,
 			replacement: rewriteConfig.Replacement,
+			hostRegex:   hostRegex,
+			pathRegex:   pathRegex,
+			status:      rewriteConfig.When.Status,
 		}
 	}
 	return rewrites, nil
 }
 
 func (p *ProxieCookiePlugin) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	requestLogger := &jsonLogger{
+		out:       os.Stderr,
+		plugin:    p.name,
+		requestID: req.Header.Get(requestIDHeader),
+		level:     p.logLevel,
+	}
+
+	p.rewriteRequestCookies(req, requestLogger)
+
 	myWriter := &responseWriter{
-		writer:         rw,
-		domainRewrites: p.domainRewrites,
-		pathPrefix:     p.pathPrefix,
-		pathRewrites:   p.pathRewrites,
+		writer:              rw,
+		request:             req,
+		domainRewrites:      p.domainRewrites,
+		pathPrefix:          p.pathPrefix,
+		pathRewrites:        p.pathRewrites,
+		cookieFilter:        p.cookieFilter,
+		attributeConfig:     p.attributeConfig,
+		enforcePublicSuffix: p.enforcePublicSuffix,
+		onInvalidDomain:     p.onInvalidDomain,
+		log:                 requestLogger,
+		stats:               p.stats,
 	}
 
 	p.next.ServeHTTP(myWriter, req)
 }
 
+// rewriteRequestCookies applies the request-side rewrite/strip rules to the
+// inbound Cookie header, the symmetric counterpart of the Set-Cookie
+// handling in responseWriter.WriteHeader.
+func (p *ProxieCookiePlugin) rewriteRequestCookies(req *http.Request, log logger) {
+	if len(p.requestCookieRewrites) == 0 && len(p.requestCookieStrip) == 0 {
+		return
+	}
+
+	mock := http.Request{Header: http.Header{"Cookie": req.Header["Cookie"]}}
+	cookies := mock.Cookies()
+	if len(cookies) == 0 {
+		return
+	}
+
+	req.Header.Del(cookieHeader)
+
+	kept := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		if matchesAnyPattern(cookie.Name, p.requestCookieStrip) {
+			log.Debugf("request cookie %q stripped", cookie.Name)
+			continue
+		}
+
+		changed := false
+		if len(p.requestCookieRewrites) > 0 {
+			originalName, originalValue := cookie.Name, cookie.Value
+
+			// No response status exists yet; a rule's Status condition
+			// therefore only ever matches on the Set-Cookie side.
+			cookie.Name = handleRewrites(cookie.Name, p.requestCookieRewrites, req, 0)
+			cookie.Value = handleRewrites(cookie.Value, p.requestCookieRewrites, req, 0)
+
+			changed = cookie.Name != originalName || cookie.Value != originalValue
+		}
+
+		// cookie.String() returns "" for an invalid name (e.g. one a
+		// rewrite mangled into containing whitespace); skip it instead of
+		// appending an empty segment that would corrupt the joined header.
+		serialized := cookie.String()
+		if serialized == "" {
+			log.Warnf("request cookie %q dropped, rewrite produced an invalid name", cookie.Name)
+			continue
+		}
+
+		if changed {
+			atomic.AddUint64(&p.stats.rewritesApplied, 1)
+		}
+
+		log.Debugf("request cookie %q rewritten, value=%s", cookie.Name, maskValue(cookie.Value))
+		kept = append(kept, serialized)
+	}
+
+	if len(kept) > 0 {
+		req.Header.Set(cookieHeader, strings.Join(kept, "; "))
+	}
+}
+
 type responseWriter struct {
-	writer         http.ResponseWriter
-	domainRewrites []rewrite
-	pathPrefix     string
-	pathRewrites   []rewrite
+	writer              http.ResponseWriter
+	request             *http.Request
+	domainRewrites      []rewrite
+	pathPrefix          string
+	pathRewrites        []rewrite
+	cookieFilter        CookieFilter
+	attributeConfig     AttributeConfig
+	enforcePublicSuffix bool
+	onInvalidDomain     string
+	log                 logger
+	stats               *statsCounters
 }
 
 func (r *responseWriter) Header() http.Header {
@@ -116,54 +457,206 @@ func (r *responseWriter) Write(bytes []byte) (int, error) {
 }
 
 func (r *responseWriter) WriteHeader(statusCode int) {
-	// Print the status code being written
-	fmt.Printf("WriteHeader called with status code: %d\n", statusCode)
+	r.log.Debugf("writing response headers, status=%d", statusCode)
 
-	// Extract headers and print them
+	// Create a mock HTTP response to extract cookies from Set-Cookie.
 	headers := r.writer.Header()
-	fmt.Printf("Original headers: %+v\n", headers)
-
-	// Create a mock HTTP response to extract cookies and print them
-	req := http.Response{Header: headers}
-	cookies := req.Cookies()
-	fmt.Printf("Extracted cookies: %+v\n", cookies)
+	resp := http.Response{Header: headers}
+	cookies := resp.Cookies()
 
 	// Delete Set-Cookie headers (if any)
 	r.writer.Header().Del(setCookieHeader)
-	fmt.Println("Set-Cookie headers deleted.")
 
 	// Iterate over the cookies and apply modifications
 	for _, cookie := range cookies {
+		if !r.allowCookie(cookie.Name) {
+			atomic.AddUint64(&r.stats.cookiesDroppedByFilter, 1)
+			r.log.Debugf("cookie %q filtered out", cookie.Name)
+			continue
+		}
+
 		originalCookie := *cookie // Copy the original cookie for comparison
 
 		// Add the prefix to the cookie path if defined
 		if len(r.pathPrefix) > 0 {
 			cookie.Path = prefixPath(cookie.Path, r.pathPrefix)
-			fmt.Printf("Path prefixed: %s -> %s\n", originalCookie.Path, cookie.Path)
 		}
 
 		// Rewrite the path using pathRewrites if defined
 		if len(r.pathRewrites) > 0 {
-			cookie.Path = handleRewrites(cookie.Path, r.pathRewrites)
-			fmt.Printf("Path rewritten: %s -> %s\n", originalCookie.Path, cookie.Path)
+			cookie.Path = handleRewrites(cookie.Path, r.pathRewrites, r.request, statusCode)
 		}
 
 		// Rewrite the domain using domainRewrites if defined
 		if len(r.domainRewrites) > 0 {
-			cookie.Domain = handleRewrites(cookie.Domain, r.domainRewrites)
-			fmt.Printf("Domain rewritten: %s -> %s\n", originalCookie.Domain, cookie.Domain)
+			cookie.Domain = handleRewrites(cookie.Domain, r.domainRewrites, r.request, statusCode)
 		}
 
-		// Print the final modified cookie before setting it
-		fmt.Printf("Final cookie to be set: %+v\n", cookie)
+		pathChanged := cookie.Path != originalCookie.Path
+
+		// Reject a rewritten domain that is a public suffix (or has no
+		// registrable portion) before it can create a super-cookie.
+		if r.enforcePublicSuffix && cookie.Domain != "" {
+			drop := false
+			cookie.Domain, drop = validateDomain(cookie.Domain, r.onInvalidDomain)
+			if drop {
+				atomic.AddUint64(&r.stats.invalidDomainsRejected, 1)
+				r.log.Warnf("cookie %q dropped, invalid domain %s", cookie.Name, cookie.Domain)
+				continue
+			}
+		}
+
+		domainChanged := cookie.Domain != originalCookie.Domain
+
+		// Apply attribute overrides after the path/domain rewrites.
+		applyAttributes(cookie, r.attributeConfig)
+		partitioned := r.attributeConfig.Partitioned != nil && *r.attributeConfig.Partitioned
+		attrsChanged := cookie.Secure != originalCookie.Secure ||
+			cookie.HttpOnly != originalCookie.HttpOnly ||
+			cookie.SameSite != originalCookie.SameSite ||
+			cookie.MaxAge != originalCookie.MaxAge ||
+			partitioned
+
+		// RewritesApplied counts every kind of rewrite this plugin can make
+		// to a Set-Cookie, not just path/domain.
+		if pathChanged || domainChanged || attrsChanged {
+			atomic.AddUint64(&r.stats.rewritesApplied, 1)
+		}
+
+		r.log.Debugf("cookie %q: pathChanged=%t domainChanged=%t attrsChanged=%t value=%s",
+			cookie.Name, pathChanged, domainChanged, attrsChanged, maskValue(cookie.Value))
 
 		// Set the modified cookie
 		http.SetCookie(r, cookie)
+
+		if partitioned {
+			appendPartitionedAttribute(r.Header())
+		}
 	}
 
 	// Write the response header
 	r.writer.WriteHeader(statusCode)
-	fmt.Println("WriteHeader completed.")
+}
+
+// validateOnInvalid rejects a domain.onInvalid config value New() can't turn
+// into defined behavior, rather than having validateDomain silently treat a
+// typo the same as "host-only".
+func validateOnInvalid(onInvalid string) error {
+	switch onInvalid {
+	case "", "host-only", "drop", "pass":
+		return nil
+	default:
+		return fmt.Errorf("invalid domain.onInvalid %q: must be one of \"host-only\", \"drop\", \"pass\"", onInvalid)
+	}
+}
+
+// validateDomain checks a rewritten cookie.Domain against the Public Suffix
+// List, mirroring the invariant net/http/cookiejar enforces on SetCookies.
+// It returns the domain to use and whether the cookie should be dropped
+// entirely, per onInvalid ("host-only"|"drop"|"pass").
+func validateDomain(domain, onInvalid string) (string, bool) {
+	bare := strings.TrimPrefix(domain, ".")
+
+	if _, err := publicsuffix.EffectiveTLDPlusOne(bare); err != nil {
+		switch onInvalid {
+		case "drop":
+			return domain, true
+		case "pass":
+			return domain, false
+		default: // "host-only"
+			return "", false
+		}
+	}
+
+	return domain, false
+}
+
+// applyAttributes unconditionally sets or clears the configured cookie
+// attributes, then repairs SameSite=None cookies missing Secure if asked to,
+// since browsers silently drop those otherwise.
+func applyAttributes(cookie *http.Cookie, cfg AttributeConfig) {
+	if cfg.Secure != nil {
+		cookie.Secure = *cfg.Secure
+	}
+
+	if cfg.HTTPOnly != nil {
+		cookie.HttpOnly = *cfg.HTTPOnly
+	}
+
+	if cfg.SameSite != "" {
+		cookie.SameSite = parseSameSite(cfg.SameSite)
+	}
+
+	if cfg.MaxAge != nil {
+		cookie.MaxAge = *cfg.MaxAge
+	}
+
+	if cfg.ForceSecureWhenSameSiteNone && cookie.SameSite == http.SameSiteNoneMode {
+		cookie.Secure = true
+	}
+}
+
+// appendPartitionedAttribute appends "; Partitioned" to the Set-Cookie value
+// http.SetCookie just wrote, since http.Cookie has no Partitioned field to
+// set before Go 1.23. Must run immediately after the matching http.SetCookie
+// call, before anything else appends another Set-Cookie header value.
+func appendPartitionedAttribute(header http.Header) {
+	values := header[setCookieHeader]
+	if len(values) == 0 {
+		return
+	}
+
+	values[len(values)-1] += "; Partitioned"
+}
+
+// validateSameSite rejects an attributes.sameSite config value New() can't
+// turn into defined behavior, rather than having parseSameSite silently
+// coerce a typo (e.g. "Strcit") to SameSiteDefaultMode.
+func validateSameSite(value string) error {
+	switch value {
+	case "", "Lax", "Strict", "None":
+		return nil
+	default:
+		return fmt.Errorf("invalid attributes.sameSite %q: must be one of \"Lax\", \"Strict\", \"None\"", value)
+	}
+}
+
+func parseSameSite(value string) http.SameSite {
+	switch value {
+	case "Lax":
+		return http.SameSiteLaxMode
+	case "Strict":
+		return http.SameSiteStrictMode
+	case "None":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteDefaultMode
+	}
+}
+
+// allowCookie reports whether a cookie named name may leave the proxy,
+// applying the deny list first and then the allow list: when Allow is
+// non-empty or DenyAll is set, only allowlisted names pass (DenyAll with an
+// empty Allow drops every cookie).
+func (r *responseWriter) allowCookie(name string) bool {
+	if matchesAnyPattern(name, r.cookieFilter.Deny) {
+		return false
+	}
+
+	if r.cookieFilter.DenyAll || len(r.cookieFilter.Allow) > 0 {
+		return matchesAnyPattern(name, r.cookieFilter.Allow)
+	}
+
+	return true
+}
+
+func matchesAnyPattern(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
 }
 
 func prefixPath(path, prefix string) string {
@@ -174,8 +667,11 @@ func prefixPath(path, prefix string) string {
 	return "/" + prefix + path
 }
 
-func handleRewrites(value string, rewrites []rewrite) string {
+func handleRewrites(value string, rewrites []rewrite, req *http.Request, statusCode int) string {
 	for _, rewrite := range rewrites {
+		if !rewrite.matches(req, statusCode) {
+			continue
+		}
 		value = rewrite.regex.ReplaceAllString(value, rewrite.replacement)
 	}
 	return value
@@ -0,0 +1,393 @@
+package traefik_plugin_proxy_cookie
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMatchesAnyPattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		cookie   string
+		patterns []string
+		want     bool
+	}{
+		{"exact match", "session", []string{"session"}, true},
+		{"no match", "session", []string{"other"}, false},
+		{"glob match", "_ga_ABC123", []string{"_ga_*"}, true},
+		{"glob no match", "session", []string{"_ga_*"}, false},
+		{"empty patterns", "session", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesAnyPattern(tt.cookie, tt.patterns); got != tt.want {
+				t.Errorf("matchesAnyPattern(%q, %v) = %v, want %v", tt.cookie, tt.patterns, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResponseWriterAllowCookie(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter CookieFilter
+		cookie string
+		want   bool
+	}{
+		{"no filter allows everything", CookieFilter{}, "session", true},
+		{"deny list blocks match", CookieFilter{Deny: []string{"session"}}, "session", false},
+		{"deny list passes others", CookieFilter{Deny: []string{"session"}}, "other", true},
+		{"deny glob blocks match", CookieFilter{Deny: []string{"_ga_*"}}, "_ga_ABC", false},
+		{"denyAll blocks unlisted", CookieFilter{DenyAll: true}, "session", false},
+		{"denyAll allows allowlisted", CookieFilter{DenyAll: true, Allow: []string{"session"}}, "session", true},
+		{
+			"deny takes priority over allow",
+			CookieFilter{DenyAll: true, Allow: []string{"session"}, Deny: []string{"session"}},
+			"session",
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := &responseWriter{cookieFilter: tt.filter}
+			if got := rw.allowCookie(tt.cookie); got != tt.want {
+				t.Errorf("allowCookie(%q) = %v, want %v", tt.cookie, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDomain(t *testing.T) {
+	tests := []struct {
+		name       string
+		domain     string
+		onInvalid  string
+		wantDomain string
+		wantDrop   bool
+	}{
+		{"registrable domain passes", "example.com", "host-only", "example.com", false},
+		{"subdomain passes", "www.example.com", "host-only", "www.example.com", false},
+		{"public suffix defaults to host-only", "co.uk", "", "", false},
+		{"public suffix host-only", "co.uk", "host-only", "", false},
+		{"public suffix drop", "co.uk", "drop", "co.uk", true},
+		{"public suffix pass", "co.uk", "pass", "co.uk", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotDomain, gotDrop := validateDomain(tt.domain, tt.onInvalid)
+			if gotDomain != tt.wantDomain || gotDrop != tt.wantDrop {
+				t.Errorf("validateDomain(%q, %q) = (%q, %v), want (%q, %v)",
+					tt.domain, tt.onInvalid, gotDomain, gotDrop, tt.wantDomain, tt.wantDrop)
+			}
+		})
+	}
+}
+
+func TestRewriteMatches(t *testing.T) {
+	mustRewrite := func(t *testing.T, cfg Rewrite) rewrite {
+		t.Helper()
+		rewrites, err := convertRewrites([]Rewrite{cfg})
+		if err != nil {
+			t.Fatalf("convertRewrites: %v", err)
+		}
+		return rewrites[0]
+	}
+
+	tests := []struct {
+		name       string
+		when       When
+		host       string
+		path       string
+		statusCode int
+		want       bool
+	}{
+		{"no condition always matches", When{}, "example.com", "/", 200, true},
+		{"host regex matches", When{HostRegex: `^example\.com$`}, "example.com", "/", 200, true},
+		{"host regex no match", When{HostRegex: `^example\.com$`}, "other.com", "/", 200, false},
+		{"path regex matches", When{PathRegex: `^/api/`}, "example.com", "/api/v1", 200, true},
+		{"path regex no match", When{PathRegex: `^/api/`}, "example.com", "/web", 200, false},
+		{"status matches", When{Status: []int{200, 302}}, "example.com", "/", 302, true},
+		{"status no match", When{Status: []int{200, 302}}, "example.com", "/", 404, false},
+		{
+			"all conditions must match",
+			When{HostRegex: `^example\.com$`, PathRegex: `^/api/`, Status: []int{200}},
+			"example.com", "/api/v1", 200, true,
+		},
+		{
+			"all conditions, one fails",
+			When{HostRegex: `^example\.com$`, PathRegex: `^/api/`, Status: []int{200}},
+			"example.com", "/web", 200, false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := mustRewrite(t, Rewrite{Regex: ".", Replacement: "x", When: tt.when})
+			req := httptest.NewRequest(http.MethodGet, "http://"+tt.host+tt.path, nil)
+			if got := rw.matches(req, tt.statusCode); got != tt.want {
+				t.Errorf("matches(%+v) = %v, want %v", tt.when, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyAttributesForceSecureWhenSameSiteNone(t *testing.T) {
+	cookie := &http.Cookie{Name: "session", SameSite: http.SameSiteNoneMode}
+
+	applyAttributes(cookie, AttributeConfig{ForceSecureWhenSameSiteNone: true})
+
+	if !cookie.Secure {
+		t.Error("expected Secure to be forced true for a SameSite=None cookie")
+	}
+}
+
+func TestApplyAttributes(t *testing.T) {
+	boolPtr := func(b bool) *bool { return &b }
+	intPtr := func(i int) *int { return &i }
+
+	tests := []struct {
+		name   string
+		cookie http.Cookie
+		cfg    AttributeConfig
+		want   http.Cookie
+	}{
+		{
+			"nil fields leave everything untouched",
+			http.Cookie{Secure: true, HttpOnly: false, SameSite: http.SameSiteLaxMode, MaxAge: 10},
+			AttributeConfig{},
+			http.Cookie{Secure: true, HttpOnly: false, SameSite: http.SameSiteLaxMode, MaxAge: 10},
+		},
+		{
+			"Secure forced true",
+			http.Cookie{Secure: false},
+			AttributeConfig{Secure: boolPtr(true)},
+			http.Cookie{Secure: true},
+		},
+		{
+			"Secure cleared false",
+			http.Cookie{Secure: true},
+			AttributeConfig{Secure: boolPtr(false)},
+			http.Cookie{Secure: false},
+		},
+		{
+			"HttpOnly forced true",
+			http.Cookie{HttpOnly: false},
+			AttributeConfig{HTTPOnly: boolPtr(true)},
+			http.Cookie{HttpOnly: true},
+		},
+		{
+			"HttpOnly cleared false",
+			http.Cookie{HttpOnly: true},
+			AttributeConfig{HTTPOnly: boolPtr(false)},
+			http.Cookie{HttpOnly: false},
+		},
+		{
+			"SameSite overridden to Strict",
+			http.Cookie{SameSite: http.SameSiteLaxMode},
+			AttributeConfig{SameSite: "Strict"},
+			http.Cookie{SameSite: http.SameSiteStrictMode},
+		},
+		{
+			"MaxAge overridden",
+			http.Cookie{MaxAge: 10},
+			AttributeConfig{MaxAge: intPtr(3600)},
+			http.Cookie{MaxAge: 3600},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cookie := tt.cookie
+			applyAttributes(&cookie, tt.cfg)
+
+			if cookie.Secure != tt.want.Secure ||
+				cookie.HttpOnly != tt.want.HttpOnly ||
+				cookie.SameSite != tt.want.SameSite ||
+				cookie.MaxAge != tt.want.MaxAge {
+				t.Errorf("applyAttributes() = %+v, want %+v", cookie, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteHeaderAppendsPartitioned(t *testing.T) {
+	truthy := true
+
+	recorder := httptest.NewRecorder()
+	http.SetCookie(recorder, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+
+	rw := &responseWriter{
+		writer:          recorder,
+		request:         httptest.NewRequest(http.MethodGet, "http://example.com/", nil),
+		attributeConfig: AttributeConfig{Partitioned: &truthy},
+		log:             &spyLogger{},
+		stats:           &statsCounters{},
+	}
+	rw.WriteHeader(http.StatusOK)
+
+	got := recorder.Header().Get("Set-Cookie")
+	if !strings.HasSuffix(got, "; Partitioned") {
+		t.Errorf("Set-Cookie = %q, want suffix %q", got, "; Partitioned")
+	}
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"empty config is valid", Config{}, false},
+		{"sameSite Lax is valid", Config{AttributeConfig: AttributeConfig{SameSite: "Lax"}}, false},
+		{"sameSite typo is rejected", Config{AttributeConfig: AttributeConfig{SameSite: "Strcit"}}, true},
+		{"onInvalid drop is valid", Config{DomainConfig: domainConfig{OnInvalid: "drop"}}, false},
+		{"onInvalid typo is rejected", Config{DomainConfig: domainConfig{OnInvalid: "Drpo"}}, true},
+	}
+
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.config
+			_, err := New(context.Background(), next, &cfg, "test")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRewriteRequestCookies(t *testing.T) {
+	tests := []struct {
+		name       string
+		rewrites   []Rewrite
+		strip      []string
+		cookieHdr  string
+		wantHeader string
+	}{
+		{"no rules leaves the header untouched", nil, nil, "a=1; b=2", "a=1; b=2"},
+		{"strip removes only the matching cookie", nil, []string{"b"}, "a=1; b=2; c=3", "a=1; c=3"},
+		{"strip glob removes matching cookies", nil, []string{"_ga_*"}, "a=1; _ga_XYZ=v", "a=1"},
+		{"stripping every cookie clears the header", nil, []string{"a", "b"}, "a=1; b=2", ""},
+		{
+			"rewrite changes the cookie value",
+			[]Rewrite{{Regex: "^old$", Replacement: "new"}},
+			nil,
+			"session=old",
+			"session=new",
+		},
+		{
+			"rewrite mangling the name into something invalid drops the cookie",
+			[]Rewrite{{Regex: "^session$", Replacement: "ses sion"}},
+			nil,
+			"session=abc",
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rewrites, err := convertRewrites(tt.rewrites)
+			if err != nil {
+				t.Fatalf("convertRewrites: %v", err)
+			}
+
+			p := &ProxieCookiePlugin{
+				requestCookieRewrites: rewrites,
+				requestCookieStrip:    tt.strip,
+				stats:                 &statsCounters{},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			req.Header.Set("Cookie", tt.cookieHdr)
+
+			p.rewriteRequestCookies(req, &spyLogger{})
+
+			if got := req.Header.Get("Cookie"); got != tt.wantHeader {
+				t.Errorf("Cookie header = %q, want %q", got, tt.wantHeader)
+			}
+		})
+	}
+}
+
+// spyLogger is a logger that records every formatted line it was asked to
+// emit, so a test can assert on what actually would have reached the log
+// stream without a real jsonLogger and *os.File plumbing.
+type spyLogger struct {
+	lines []string
+}
+
+func (s *spyLogger) Debugf(format string, args ...interface{}) {
+	s.lines = append(s.lines, fmt.Sprintf(format, args...))
+}
+
+func (s *spyLogger) Infof(format string, args ...interface{}) {
+	s.lines = append(s.lines, fmt.Sprintf(format, args...))
+}
+
+func (s *spyLogger) Warnf(format string, args ...interface{}) {
+	s.lines = append(s.lines, fmt.Sprintf(format, args...))
+}
+
+func TestLoggingNeverLeaksCookieValues(t *testing.T) {
+	const secret = "super-secret-session-id-should-never-be-logged"
+
+	t.Run("Set-Cookie response path", func(t *testing.T) {
+		spy := &spyLogger{}
+		recorder := httptest.NewRecorder()
+		http.SetCookie(recorder, &http.Cookie{Name: "session", Value: secret, Path: "/"})
+
+		rw := &responseWriter{
+			writer:  recorder,
+			request: httptest.NewRequest(http.MethodGet, "http://example.com/", nil),
+			log:     spy,
+			stats:   &statsCounters{},
+		}
+		rw.WriteHeader(http.StatusOK)
+
+		assertNoLeakedValue(t, spy.lines, secret)
+	})
+
+	t.Run("Cookie request path", func(t *testing.T) {
+		spy := &spyLogger{}
+		p := &ProxieCookiePlugin{
+			requestCookieStrip: []string{"nonexistent"},
+			stats:              &statsCounters{},
+		}
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.Header.Set("Cookie", "session="+secret)
+
+		p.rewriteRequestCookies(req, spy)
+
+		assertNoLeakedValue(t, spy.lines, secret)
+	})
+}
+
+// assertNoLeakedValue fails if any captured log line contains the raw secret,
+// and requires at least one line to carry maskValue's redacted form instead —
+// otherwise a future edit could drop the logging call and this test wouldn't
+// notice.
+func assertNoLeakedValue(t *testing.T, lines []string, secret string) {
+	t.Helper()
+
+	if len(lines) == 0 {
+		t.Fatal("expected at least one log line to be captured")
+	}
+
+	maskedForm := maskValue(secret)
+	sawMasked := false
+	for _, line := range lines {
+		if strings.Contains(line, secret) {
+			t.Fatalf("log line leaked the raw cookie value: %q", line)
+		}
+		if strings.Contains(line, maskedForm) {
+			sawMasked = true
+		}
+	}
+	if !sawMasked {
+		t.Errorf("expected a log line containing the masked value %q, got %v", maskedForm, lines)
+	}
+}